@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"sort"
+
+	"google.golang.org/genproto/googleapis/api/distribution"
+)
+
+// Buckets defines how raw observations are binned into a Distribution's
+// BucketCounts, and produces the matching BucketOptions proto. GCM requires
+// len(BucketCounts) == len(bounds)+1 and rejects Range, so SeriesGrouper
+// relies on Buckets to get both right.
+type Buckets interface {
+	// Options returns the BucketOptions to attach to the Distribution.
+	Options() *distribution.Distribution_BucketOptions
+	// Index returns the BucketCounts slot value falls into.
+	Index(value float64) int
+	// NumBuckets returns the total number of buckets, i.e. len(BucketCounts).
+	NumBuckets() int
+}
+
+// ExplicitBuckets bins values against an explicit, ascending list of finite
+// bounds, matching distribution.Distribution_BucketOptions_Explicit.
+func ExplicitBuckets(bounds []float64) Buckets {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	return explicitBuckets{bounds: sorted}
+}
+
+type explicitBuckets struct {
+	bounds []float64
+}
+
+func (b explicitBuckets) Options() *distribution.Distribution_BucketOptions {
+	return &distribution.Distribution_BucketOptions{
+		Options: &distribution.Distribution_BucketOptions_ExplicitBuckets{
+			ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{
+				Bounds: b.bounds,
+			},
+		},
+	}
+}
+
+func (b explicitBuckets) NumBuckets() int {
+	return len(b.bounds) + 1
+}
+
+func (b explicitBuckets) Index(value float64) int {
+	// Bucket i covers [bounds[i-1], bounds[i]), i.e. lower-bound inclusive, so
+	// the index is the first bound strictly greater than value. Using
+	// sort.SearchFloat64s (bounds[i] >= value) would instead put a value equal
+	// to a bound into the bucket below it.
+	return sort.Search(len(b.bounds), func(i int) bool {
+		return b.bounds[i] > value
+	})
+}
+
+// ExponentialBuckets bins values against numFiniteBuckets buckets whose
+// boundaries grow geometrically as scale * growthFactor^i, matching
+// distribution.Distribution_BucketOptions_Exponential.
+func ExponentialBuckets(numFiniteBuckets int32, growthFactor, scale float64) Buckets {
+	return exponentialBuckets{
+		numFiniteBuckets: numFiniteBuckets,
+		growthFactor:     growthFactor,
+		scale:            scale,
+	}
+}
+
+type exponentialBuckets struct {
+	numFiniteBuckets int32
+	growthFactor     float64
+	scale            float64
+}
+
+func (b exponentialBuckets) Options() *distribution.Distribution_BucketOptions {
+	return &distribution.Distribution_BucketOptions{
+		Options: &distribution.Distribution_BucketOptions_ExponentialBuckets{
+			ExponentialBuckets: &distribution.Distribution_BucketOptions_Exponential{
+				NumFiniteBuckets: b.numFiniteBuckets,
+				GrowthFactor:     b.growthFactor,
+				Scale:            b.scale,
+			},
+		},
+	}
+}
+
+func (b exponentialBuckets) NumBuckets() int {
+	return int(b.numFiniteBuckets) + 2 // underflow bucket + finite buckets + overflow bucket
+}
+
+func (b exponentialBuckets) Index(value float64) int {
+	// bound walks scale*growthFactor^i for i in [0, numFiniteBuckets]: i=0 is
+	// the underflow/bucket-1 boundary, and i=numFiniteBuckets is the boundary
+	// between the last finite bucket and overflow. That's numFiniteBuckets+1
+	// boundaries to check before falling through to the overflow bucket.
+	bound := b.scale
+	for i := 0; i <= int(b.numFiniteBuckets); i++ {
+		if value < bound {
+			return i
+		}
+		bound *= b.growthFactor
+	}
+	return int(b.numFiniteBuckets) + 1
+}
@@ -0,0 +1,61 @@
+package exporter
+
+import "testing"
+
+func TestExplicitBucketsIndex(t *testing.T) {
+	b := ExplicitBuckets([]float64{10, 50, 70})
+
+	tests := []struct {
+		value float64
+		want  int
+	}{
+		{value: -5, want: 0}, // underflow
+		{value: 9.99, want: 0},
+		{value: 10, want: 1}, // lower-bound inclusive: [10, 50)
+		{value: 49.99, want: 1},
+		{value: 50, want: 2}, // [50, 70)
+		{value: 69.99, want: 2},
+		{value: 70, want: 3}, // overflow: [70, +inf)
+		{value: 1000, want: 3},
+	}
+	for _, tt := range tests {
+		if got := b.Index(tt.value); got != tt.want {
+			t.Errorf("Index(%v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExponentialBucketsIndex(t *testing.T) {
+	b := ExponentialBuckets(2, 10, 1)
+
+	tests := []struct {
+		value float64
+		want  int
+	}{
+		{value: 0.5, want: 0}, // underflow: value < scale (1)
+		{value: 1, want: 1},   // [1, 10)
+		{value: 9.99, want: 1},
+		{value: 10, want: 2}, // [10, 100), the last finite bucket
+		{value: 50, want: 2},
+		{value: 99.99, want: 2},
+		{value: 100, want: 3}, // overflow: value >= scale*growth^numFiniteBuckets
+		{value: 1000, want: 3},
+	}
+	for _, tt := range tests {
+		if got := b.Index(tt.value); got != tt.want {
+			t.Errorf("Index(%v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBucketsNumBucketsMatchesBucketCountsLength(t *testing.T) {
+	explicit := ExplicitBuckets([]float64{10, 50, 70})
+	if got, want := explicit.NumBuckets(), 4; got != want {
+		t.Errorf("ExplicitBuckets.NumBuckets() = %d, want %d", got, want)
+	}
+
+	exponential := ExponentialBuckets(2, 10, 1)
+	if got, want := exponential.NumBuckets(), 4; got != want {
+		t.Errorf("ExponentialBuckets.NumBuckets() = %d, want %d", got, want)
+	}
+}
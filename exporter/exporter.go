@@ -0,0 +1,316 @@
+// Package exporter batches monitoring time series and flushes them to Google
+// Cloud Monitoring in a background loop, instead of issuing one
+// CreateTimeSeries call per write.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"go.opentelemetry.io/otel/metric"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxSeriesPerRequest is GCM's hard cap on the number of TimeSeries allowed
+// in a single CreateTimeSeries/CreateServiceTimeSeries request.
+const maxSeriesPerRequest = 200
+
+// defaultFlushInterval is how often the exporter flushes buffered series when
+// the buffer hasn't already filled to maxSeriesPerRequest.
+const defaultFlushInterval = 10 * time.Second
+
+// Exporter buffers TimeSeries per-project and flushes them to Google Cloud
+// Monitoring in batches, retrying transient failures with backoff and
+// dropping points GCM rejects as permanently invalid.
+type Exporter struct {
+	client *monitoring.MetricClient
+
+	// sendTimeSeries defaults to client.CreateTimeSeries (or
+	// CreateServiceTimeSeries, under WithServiceTimeSeries); tests substitute
+	// a fake so flushProject's chunking and sendWithRetry's classification
+	// and drop-counting logic can be exercised without a real MetricClient.
+	sendTimeSeries func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error
+
+	flushInterval time.Duration
+	maxRetries    int
+	metrics       *ClientMetrics
+
+	mu      sync.Mutex
+	pending map[string][]*monitoringpb.TimeSeries // keyed by "projects/{projectID}"
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// Option configures an Exporter.
+type Option func(*Exporter)
+
+// WithFlushInterval overrides how often buffered points are flushed when the
+// buffer hasn't already reached maxSeriesPerRequest. The default is 10s.
+func WithFlushInterval(d time.Duration) Option {
+	return func(e *Exporter) { e.flushInterval = d }
+}
+
+// WithMaxRetries caps the number of retry attempts for a retryable error
+// before the batch is dropped. The default is 5.
+func WithMaxRetries(n int) Option {
+	return func(e *Exporter) { e.maxRetries = n }
+}
+
+// WithServiceTimeSeries makes the exporter call CreateServiceTimeSeries
+// instead of CreateTimeSeries, as required for SLO-monitoring service
+// metrics under the custom.googleapis.com namespace. It must be passed to
+// New before any send has occurred.
+func WithServiceTimeSeries() Option {
+	return func(e *Exporter) {
+		e.sendTimeSeries = func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+			return e.client.CreateServiceTimeSeries(ctx, &monitoringpb.CreateTimeSeriesRequest{
+				Name:       name,
+				TimeSeries: chunk,
+			})
+		}
+	}
+}
+
+// WithClientMetrics instruments the exporter with OpenTelemetry counters and
+// histograms — request counts by status code, write latency, and points
+// dropped by reason — created against mp. This lets a user observe the
+// health of their own publishing pipeline rather than only seeing failures
+// surface as returned errors.
+func WithClientMetrics(mp metric.MeterProvider) Option {
+	return func(e *Exporter) { e.metrics = newClientMetrics(mp) }
+}
+
+// New creates an Exporter that writes through client. Callers must call
+// Start to begin the background flush loop and Shutdown to drain it.
+func New(client *monitoring.MetricClient, opts ...Option) *Exporter {
+	e := &Exporter{
+		client:        client,
+		flushInterval: defaultFlushInterval,
+		maxRetries:    5,
+		pending:       make(map[string][]*monitoringpb.TimeSeries),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.sendTimeSeries == nil {
+		e.sendTimeSeries = func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+			return e.client.CreateTimeSeries(ctx, &monitoringpb.CreateTimeSeriesRequest{
+				Name:       name,
+				TimeSeries: chunk,
+			})
+		}
+	}
+	return e
+}
+
+// Start begins the background flush loop. It returns immediately; call
+// Shutdown to stop the loop and flush any remaining points.
+func (e *Exporter) Start() {
+	go e.flushLoop()
+}
+
+// Add buffers series for later flushing, grouped by name as given (e.g.
+// "projects/my-project"). Add does no network I/O unless that buffer reaches
+// maxSeriesPerRequest, in which case it flushes it synchronously.
+func (e *Exporter) Add(ctx context.Context, name string, series ...*monitoringpb.TimeSeries) error {
+	e.mu.Lock()
+	e.pending[name] = append(e.pending[name], series...)
+	full := len(e.pending[name]) >= maxSeriesPerRequest
+	e.mu.Unlock()
+
+	if full {
+		return e.flushProject(ctx, name)
+	}
+	return nil
+}
+
+func (e *Exporter) flushLoop() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.flushAll(context.Background())
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// flushAll flushes every project's buffer, logging but not returning errors
+// since the flush loop has no caller to report to.
+func (e *Exporter) flushAll(ctx context.Context) {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.pending))
+	for name := range e.pending {
+		names = append(names, name)
+	}
+	e.mu.Unlock()
+
+	for _, name := range names {
+		if err := e.flushProject(ctx, name); err != nil {
+			slog.Error("flush time series", slog.String("project", name), slog.Any("err", err))
+		}
+	}
+}
+
+// flushProject drains and sends all buffered series for name in batches of
+// maxSeriesPerRequest, retrying retryable batches and dropping permanently
+// invalid ones.
+func (e *Exporter) flushProject(ctx context.Context, name string) error {
+	e.mu.Lock()
+	batch := e.pending[name]
+	delete(e.pending, name)
+	e.mu.Unlock()
+
+	var errs []error
+	for len(batch) > 0 {
+		n := maxSeriesPerRequest
+		if n > len(batch) {
+			n = len(batch)
+		}
+		chunk := batch[:n]
+		batch = batch[n:]
+		if err := e.sendWithRetry(ctx, name, chunk); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendWithRetry sends chunk, retrying on retryable errors with exponential
+// backoff and jitter. If GCM reports a partial CreateTimeSeriesSummary, the
+// rejected points are dropped and logged rather than retried, since the
+// summary identifies counts and statuses but not which points in the
+// request they correspond to.
+func (e *Exporter) sendWithRetry(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+	for attempt := 0; ; attempt++ {
+		err := e.send(ctx, name, chunk)
+		if err == nil {
+			return nil
+		}
+
+		class, summary := classify(err)
+		if summary != nil && summary.GetSuccessPointCount() > 0 {
+			// GCM accepted some points and rejected others in the same batch;
+			// the rejected ones can't be resubmitted, so log and move on.
+			for _, se := range summary.GetErrors() {
+				slog.Warn("gcm rejected time series points",
+					slog.String("project", name),
+					slog.Int("count", int(se.GetPointCount())),
+					slog.String("status", se.GetStatus().String()))
+				e.metrics.recordDropped(ctx, dropReasonForCode(codes.Code(se.GetStatus().GetCode())), int64(se.GetPointCount()))
+			}
+			return nil
+		}
+
+		if class != classRetryable || attempt >= e.maxRetries {
+			// The whole chunk is being dropped, either because GCM rejected it
+			// outright with no per-point summary (e.g. every point shares one
+			// bad label) or because retries are exhausted, so count every
+			// point in it rather than just the partial-failure case above.
+			e.metrics.recordDropped(ctx, dropReasonForCode(status.Code(err)), int64(len(chunk)))
+			return fmt.Errorf("send time series to %s: %w", name, err)
+		}
+
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Exporter) send(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+	start := time.Now()
+	err := e.sendTimeSeries(ctx, name, chunk)
+	e.metrics.recordWrite(ctx, status.Code(err).String(), float64(time.Since(start).Milliseconds()))
+	return err
+}
+
+// dropReasonForCode maps a GCM error code to the reason label recorded on
+// the gcm.points.dropped counter.
+func dropReasonForCode(code codes.Code) dropReason {
+	switch code {
+	case codes.DeadlineExceeded:
+		return dropReasonDeadline
+	case codes.OutOfRange:
+		return dropReasonOutOfOrder
+	default:
+		return dropReasonInvalidArgument
+	}
+}
+
+// Shutdown stops the flush loop and flushes all pending points, waiting at
+// most until ctx is done.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown exporter: %w", ctx.Err())
+	}
+	e.flushAll(ctx)
+	return nil
+}
+
+type errClass int
+
+const (
+	classPermanent errClass = iota
+	classRetryable
+)
+
+// classify determines whether err from a GCM write call should be retried,
+// and extracts the CreateTimeSeriesSummary if GCM attached one giving the
+// counts and statuses of the points in the batch it rejected.
+func classify(err error) (errClass, *monitoringpb.CreateTimeSeriesSummary) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return classRetryable, nil
+	}
+
+	var summary *monitoringpb.CreateTimeSeriesSummary
+	for _, d := range st.Details() {
+		if s, ok := d.(*monitoringpb.CreateTimeSeriesSummary); ok {
+			summary = s
+		}
+	}
+
+	switch st.Code() {
+	case codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return classRetryable, summary
+	case codes.InvalidArgument, codes.AlreadyExists, codes.FailedPrecondition, codes.PermissionDenied, codes.NotFound:
+		return classPermanent, summary
+	default:
+		return classRetryable, summary
+	}
+}
+
+// backoff returns an exponential backoff duration for the given attempt
+// number (0-indexed), with up to 20% jitter to avoid thundering-herd
+// retries across many exporters.
+func backoff(attempt int) time.Duration {
+	const base = 200 * time.Millisecond
+	const max = 30 * time.Second
+
+	d := base * time.Duration(1<<uint(attempt))
+	if d > max || d <= 0 {
+		d = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(d) / 5))
+	return d + jitter
+}
@@ -0,0 +1,199 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestExporter(send func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error) *Exporter {
+	return &Exporter{
+		sendTimeSeries: send,
+		flushInterval:  defaultFlushInterval,
+		maxRetries:     2,
+		pending:        make(map[string][]*monitoringpb.TimeSeries),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+}
+
+func TestClassify(t *testing.T) {
+	summary := &monitoringpb.CreateTimeSeriesSummary{TotalPointCount: 1}
+	withSummary := func(code codes.Code) error {
+		st, err := status.New(code, "boom").WithDetails(summary)
+		if err != nil {
+			t.Fatalf("attach details: %v", err)
+		}
+		return st.Err()
+	}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantClass   errClass
+		wantSummary bool
+	}{
+		{"deadline exceeded is retryable", status.Error(codes.DeadlineExceeded, "timeout"), classRetryable, false},
+		{"unavailable is retryable", status.Error(codes.Unavailable, "down"), classRetryable, false},
+		{"resource exhausted is retryable", status.Error(codes.ResourceExhausted, "quota"), classRetryable, false},
+		{"aborted is retryable", status.Error(codes.Aborted, "conflict"), classRetryable, false},
+		{"invalid argument is permanent", status.Error(codes.InvalidArgument, "bad"), classPermanent, false},
+		{"already exists is permanent", status.Error(codes.AlreadyExists, "dup"), classPermanent, false},
+		{"failed precondition is permanent", status.Error(codes.FailedPrecondition, "precondition"), classPermanent, false},
+		{"permission denied is permanent", status.Error(codes.PermissionDenied, "denied"), classPermanent, false},
+		{"not found is permanent", status.Error(codes.NotFound, "missing"), classPermanent, false},
+		{"unknown code defaults to retryable", status.Error(codes.Internal, "oops"), classRetryable, false},
+		{"non-status error defaults to retryable", context.DeadlineExceeded, classRetryable, false},
+		{"invalid argument with summary", withSummary(codes.InvalidArgument), classPermanent, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, summary := classify(tt.err)
+			if class != tt.wantClass {
+				t.Errorf("classify(%v) class = %v, want %v", tt.err, class, tt.wantClass)
+			}
+			if (summary != nil) != tt.wantSummary {
+				t.Errorf("classify(%v) summary = %v, want non-nil=%v", tt.err, summary, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestBackoffGrowsExponentiallyAndCaps(t *testing.T) {
+	var prev time.Duration
+	for attempt := 0; attempt < 6; attempt++ {
+		d := backoff(attempt)
+		// Strip jitter's up-to-20% by comparing against the un-jittered base.
+		base := 200 * time.Millisecond * time.Duration(1<<uint(attempt))
+		if d < base {
+			t.Errorf("backoff(%d) = %v, want >= base %v", attempt, d, base)
+		}
+		if attempt > 0 && d <= prev {
+			t.Errorf("backoff(%d) = %v, want > backoff(%d) = %v", attempt, d, attempt-1, prev)
+		}
+		prev = d
+	}
+
+	// A high attempt count would overflow the shift; backoff must cap at 30s
+	// (plus jitter) instead of wrapping around to a tiny or negative duration.
+	d := backoff(62)
+	if d < 30*time.Second || d > 36*time.Second {
+		t.Errorf("backoff(62) = %v, want capped to ~30s-36s", d)
+	}
+}
+
+func TestFlushProjectChunksAtMaxSeriesPerRequest(t *testing.T) {
+	var gotChunkSizes []int
+	var mu sync.Mutex
+	e := newTestExporter(func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+		mu.Lock()
+		gotChunkSizes = append(gotChunkSizes, len(chunk))
+		mu.Unlock()
+		return nil
+	})
+
+	series := make([]*monitoringpb.TimeSeries, maxSeriesPerRequest+1)
+	for i := range series {
+		series[i] = &monitoringpb.TimeSeries{}
+	}
+	if err := e.Add(context.Background(), "projects/p", series...); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := e.flushProject(context.Background(), "projects/p"); err != nil {
+		t.Fatalf("flushProject: %v", err)
+	}
+
+	if got, want := gotChunkSizes, []int{maxSeriesPerRequest, 1}; !equalInts(got, want) {
+		t.Errorf("chunk sizes = %v, want %v", got, want)
+	}
+}
+
+func TestSendWithRetryRetriesThenSucceeds(t *testing.T) {
+	var attempts int32
+	e := newTestExporter(func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			return status.Error(codes.Unavailable, "try again")
+		}
+		return nil
+	})
+
+	chunk := []*monitoringpb.TimeSeries{{}}
+	if err := e.sendWithRetry(context.Background(), "projects/p", chunk); err != nil {
+		t.Fatalf("sendWithRetry: %v", err)
+	}
+	if got, want := atomic.LoadInt32(&attempts), int32(3); got != want {
+		t.Errorf("attempts = %d, want %d", got, want)
+	}
+}
+
+func TestSendWithRetryGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+	e := newTestExporter(func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+		atomic.AddInt32(&attempts, 1)
+		return status.Error(codes.Unavailable, "always down")
+	})
+	e.maxRetries = 2
+
+	chunk := []*monitoringpb.TimeSeries{{}}
+	err := e.sendWithRetry(context.Background(), "projects/p", chunk)
+	if err == nil {
+		t.Fatal("sendWithRetry: want error after exhausting retries")
+	}
+	if got, want := atomic.LoadInt32(&attempts), int32(3); got != want { // initial attempt + 2 retries
+		t.Errorf("attempts = %d, want %d", got, want)
+	}
+}
+
+func TestSendWithRetryDropsWholeChunkOnPermanentError(t *testing.T) {
+	e := newTestExporter(func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+		return status.Error(codes.InvalidArgument, "bad label")
+	})
+
+	chunk := []*monitoringpb.TimeSeries{{}, {}, {}}
+	err := e.sendWithRetry(context.Background(), "projects/p", chunk)
+	if err == nil {
+		t.Fatal("sendWithRetry: want error on permanent failure")
+	}
+}
+
+func TestSendWithRetryLogsAndSwallowsPartialFailure(t *testing.T) {
+	summary := &monitoringpb.CreateTimeSeriesSummary{
+		TotalPointCount:   2,
+		SuccessPointCount: 1,
+		Errors: []*monitoringpb.CreateTimeSeriesSummary_Error{
+			{Status: &rpcstatus.Status{Code: int32(codes.InvalidArgument)}, PointCount: 1},
+		},
+	}
+	e := newTestExporter(func(ctx context.Context, name string, chunk []*monitoringpb.TimeSeries) error {
+		st, err := status.New(codes.InvalidArgument, "partial failure").WithDetails(summary)
+		if err != nil {
+			t.Fatalf("attach details: %v", err)
+		}
+		return st.Err()
+	})
+
+	chunk := []*monitoringpb.TimeSeries{{}, {}}
+	if err := e.sendWithRetry(context.Background(), "projects/p", chunk); err != nil {
+		t.Errorf("sendWithRetry: %v, want nil (partial failures are logged, not returned)", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
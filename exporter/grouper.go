@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/genproto/googleapis/api/distribution"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SeriesGrouper accepts raw observations and, on Flush, coalesces the ones
+// that share a metric type, label set, and monitored resource into a single
+// TimeSeries with an aggregated Distribution value. This is the grouping
+// approach Telegraf's stackdriver input uses to let callers record
+// individual sample values (e.g. per-request latencies) instead of
+// hand-building a Distribution.
+type SeriesGrouper struct {
+	buckets Buckets
+	unit    string
+
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+// NewSeriesGrouper creates a SeriesGrouper that aggregates observations into
+// Distributions binned according to buckets. unit is set on every emitted
+// TimeSeries and must match the Unit on the metric's MetricDescriptor: GCM
+// only accepts a TimeSeries.Unit on the write that first sets it, and
+// silently ignores it thereafter, so an empty or mismatched unit here would
+// make every subsequent write look like a "unit coerced" diff to anything
+// reading the series back.
+func NewSeriesGrouper(buckets Buckets, unit string) *SeriesGrouper {
+	return &SeriesGrouper{
+		buckets: buckets,
+		unit:    unit,
+		groups:  make(map[string]*group),
+	}
+}
+
+// group holds the running Welford aggregation for one (metricType, labels,
+// resource) tuple.
+type group struct {
+	metricType string
+	labels     map[string]string
+	resource   *monitoredres.MonitoredResource
+
+	count        int64
+	mean         float64
+	m2           float64 // sum of squared deviations from the mean
+	bucketCounts []int64
+	lastTime     *timestamppb.Timestamp
+}
+
+// Add records a single observation taken at timestamp. The emitted TimeSeries uses the latest timestamp seen for a group as its
+// (start, end) interval, matching the gauge convention that start == end.
+func (g *SeriesGrouper) Add(metricType string, labels map[string]string, resource *monitoredres.MonitoredResource, timestamp *timestamppb.Timestamp, value float64) {
+	key := groupKey(metricType, labels, resource)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	grp, ok := g.groups[key]
+	if !ok {
+		grp = &group{
+			metricType:   metricType,
+			labels:       labels,
+			resource:     resource,
+			bucketCounts: make([]int64, g.buckets.NumBuckets()),
+		}
+		g.groups[key] = grp
+	}
+
+	// Welford's online algorithm for numerically stable mean and variance.
+	grp.count++
+	delta := value - grp.mean
+	grp.mean += delta / float64(grp.count)
+	delta2 := value - grp.mean
+	grp.m2 += delta * delta2
+
+	grp.bucketCounts[g.buckets.Index(value)]++
+	if grp.lastTime == nil || timestamp.AsTime().After(grp.lastTime.AsTime()) {
+		grp.lastTime = timestamp
+	}
+}
+
+// Flush returns one TimeSeries per group accumulated since the last Flush,
+// and resets the grouper.
+func (g *SeriesGrouper) Flush() []*monitoringpb.TimeSeries {
+	g.mu.Lock()
+	groups := g.groups
+	g.groups = make(map[string]*group)
+	g.mu.Unlock()
+
+	series := make([]*monitoringpb.TimeSeries, 0, len(groups))
+	for _, grp := range groups {
+		series = append(series, &monitoringpb.TimeSeries{
+			Metric:     &metricpb.Metric{Type: grp.metricType, Labels: grp.labels},
+			Resource:   grp.resource,
+			MetricKind: metricpb.MetricDescriptor_GAUGE,
+			ValueType:  metricpb.MetricDescriptor_DISTRIBUTION,
+			Unit:       g.unit,
+			Points: []*monitoringpb.Point{{
+				Interval: &monitoringpb.TimeInterval{
+					StartTime: grp.lastTime,
+					EndTime:   grp.lastTime,
+				},
+				Value: &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DistributionValue{
+					DistributionValue: &distribution.Distribution{
+						Count:                 grp.count,
+						Mean:                  grp.mean,
+						SumOfSquaredDeviation: grp.m2,
+						Range:                 nil, // GCM errors if set: "Distribution range is not supported"
+						BucketOptions:         g.buckets.Options(),
+						BucketCounts:          grp.bucketCounts,
+					},
+				}},
+			}},
+		})
+	}
+	return series
+}
+
+// groupKey builds a stable key for a (metricType, labels, resource) tuple by
+// sorting the label keys before joining, so iteration order never affects
+// grouping.
+func groupKey(metricType string, labels map[string]string, resource *monitoredres.MonitoredResource) string {
+	var b strings.Builder
+	b.WriteString(metricType)
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString("\x1f")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+
+	if resource != nil {
+		b.WriteString("\x1e")
+		b.WriteString(resource.GetType())
+		resKeys := make([]string, 0, len(resource.GetLabels()))
+		for k := range resource.GetLabels() {
+			resKeys = append(resKeys, k)
+		}
+		sort.Strings(resKeys)
+		for _, k := range resKeys {
+			b.WriteString("\x1f")
+			b.WriteString(k)
+			b.WriteString("=")
+			b.WriteString(resource.GetLabels()[k])
+		}
+	}
+
+	return b.String()
+}
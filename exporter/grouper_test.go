@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSeriesGrouperAggregatesByKey(t *testing.T) {
+	g := NewSeriesGrouper(ExplicitBuckets([]float64{10, 50, 70}), "ms")
+	res := &monitoredres.MonitoredResource{Type: "generic_task", Labels: map[string]string{"job": "test"}}
+	now := timestamppb.Now()
+
+	g.Add("custom.googleapis.com/test", map[string]string{"key_a": "value-a"}, res, now, 20)
+	g.Add("custom.googleapis.com/test", map[string]string{"key_a": "value-a"}, res, now, 60)
+	g.Add("custom.googleapis.com/test", map[string]string{"key_a": "value-b"}, res, now, 5)
+
+	series := g.Flush()
+	if got, want := len(series), 2; got != want {
+		t.Fatalf("Flush() returned %d series, want %d", got, want)
+	}
+
+	var matched *monitoredres.MonitoredResource
+	for _, s := range series {
+		if s.GetMetric().GetLabels()["key_a"] != "value-a" {
+			continue
+		}
+		matched = s.GetResource()
+
+		if got, want := s.GetUnit(), "ms"; got != want {
+			t.Errorf("Unit = %q, want %q", got, want)
+		}
+
+		dist := s.GetPoints()[0].GetValue().GetDistributionValue()
+		if got, want := dist.GetCount(), int64(2); got != want {
+			t.Errorf("Count = %d, want %d", got, want)
+		}
+		if got, want := dist.GetMean(), 40.0; got != want {
+			t.Errorf("Mean = %v, want %v", got, want)
+		}
+		if got, want := dist.GetBucketCounts(), ([]int64{0, 1, 1, 0}); !bucketCountsEqual(got, want) {
+			t.Errorf("BucketCounts = %v, want %v", got, want)
+		}
+	}
+	if matched == nil {
+		t.Fatal("no series for key_a=value-a group")
+	}
+	if got, want := matched.GetType(), "generic_task"; got != want {
+		t.Errorf("Resource.Type = %q, want %q", got, want)
+	}
+
+	if got := g.Flush(); len(got) != 0 {
+		t.Errorf("Flush() after a prior Flush returned %d series, want 0", len(got))
+	}
+}
+
+func bucketCountsEqual(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
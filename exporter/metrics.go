@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instrumentationName identifies this package's instruments to whatever
+// OpenTelemetry SDK the caller has wired up, following the Bigtable
+// client-side-metrics pattern of instrumenting the client library itself
+// rather than leaving that to callers.
+const instrumentationName = "github.com/jschaf/gcp-monitoring-resource-weirdness/exporter"
+
+// selfObservabilityMetricPrefix is the custom metric namespace a caller can
+// publish ClientMetrics under if they want to see their own publishing
+// pipeline in GCM (via a second MetricClient/exporter pair, so publishing
+// the client's own metrics can't recursively fail the same way as the
+// metrics it's trying to export). WithClientMetrics only wires up the
+// OpenTelemetry instruments; forwarding them into GCM under this prefix is
+// left to the caller's existing OTel->GCM pipeline.
+const selfObservabilityMetricPrefix = "custom.googleapis.com/gcp_monitoring_client/"
+
+// dropReason labels the gcm.points.dropped counter.
+type dropReason string
+
+const (
+	dropReasonInvalidArgument dropReason = "invalid_argument"
+	dropReasonOutOfOrder      dropReason = "out_of_order"
+	dropReasonDeadline        dropReason = "deadline"
+)
+
+// ClientMetrics instruments the exporter and DescriptorRegistry with
+// OpenTelemetry counters and histograms, so a user can observe the health of
+// their own publishing pipeline instead of only seeing failures surface as
+// returned errors.
+type ClientMetrics struct {
+	writeRequests       metric.Int64Counter
+	writeLatency        metric.Float64Histogram
+	pointsDropped       metric.Int64Counter
+	descriptorsCreated  metric.Int64Counter
+	descriptorCacheHits metric.Int64Counter
+}
+
+// newClientMetrics creates the instruments against mp. It panics on
+// instrument-creation errors, which only happen if the instrument
+// descriptions are malformed — a programmer error, not a runtime condition.
+func newClientMetrics(mp metric.MeterProvider) *ClientMetrics {
+	meter := mp.Meter(instrumentationName)
+
+	writeRequests, err := meter.Int64Counter("gcm.write.request.count",
+		metric.WithDescription("Number of CreateTimeSeries/CreateServiceTimeSeries requests, by status code."))
+	if err != nil {
+		panic(fmt.Sprintf("create gcm.write.request.count instrument: %v", err))
+	}
+	writeLatency, err := meter.Float64Histogram("gcm.write.request.latency",
+		metric.WithDescription("Latency of CreateTimeSeries/CreateServiceTimeSeries requests."),
+		metric.WithUnit("ms"))
+	if err != nil {
+		panic(fmt.Sprintf("create gcm.write.request.latency instrument: %v", err))
+	}
+	pointsDropped, err := meter.Int64Counter("gcm.points.dropped",
+		metric.WithDescription("Number of points dropped without being written, by reason."))
+	if err != nil {
+		panic(fmt.Sprintf("create gcm.points.dropped instrument: %v", err))
+	}
+	descriptorsCreated, err := meter.Int64Counter("gcm.descriptors.created",
+		metric.WithDescription("Number of CreateMetricDescriptor calls that succeeded."))
+	if err != nil {
+		panic(fmt.Sprintf("create gcm.descriptors.created instrument: %v", err))
+	}
+	descriptorCacheHits, err := meter.Int64Counter("gcm.descriptors.cache_hits",
+		metric.WithDescription("Number of DescriptorRegistry.Ensure calls served from cache."))
+	if err != nil {
+		panic(fmt.Sprintf("create gcm.descriptors.cache_hits instrument: %v", err))
+	}
+
+	return &ClientMetrics{
+		writeRequests:       writeRequests,
+		writeLatency:        writeLatency,
+		pointsDropped:       pointsDropped,
+		descriptorsCreated:  descriptorsCreated,
+		descriptorCacheHits: descriptorCacheHits,
+	}
+}
+
+func (m *ClientMetrics) recordWrite(ctx context.Context, statusCode string, latencyMS float64) {
+	if m == nil {
+		return
+	}
+	attr := metric.WithAttributes(statusCodeAttr(statusCode))
+	m.writeRequests.Add(ctx, 1, attr)
+	m.writeLatency.Record(ctx, latencyMS, attr)
+}
+
+func (m *ClientMetrics) recordDropped(ctx context.Context, reason dropReason, count int64) {
+	if m == nil || count == 0 {
+		return
+	}
+	m.pointsDropped.Add(ctx, count, metric.WithAttributes(dropReasonAttr(reason)))
+}
+
+func (m *ClientMetrics) recordDescriptorCreated(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.descriptorsCreated.Add(ctx, 1)
+}
+
+func (m *ClientMetrics) recordDescriptorCacheHit(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.descriptorCacheHits.Add(ctx, 1)
+}
+
+func statusCodeAttr(code string) attribute.KeyValue {
+	return attribute.String("status_code", code)
+}
+
+func dropReasonAttr(reason dropReason) attribute.KeyValue {
+	return attribute.String("reason", string(reason))
+}
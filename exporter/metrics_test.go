@@ -0,0 +1,34 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestNewClientMetricsCreatesInstruments(t *testing.T) {
+	// newClientMetrics panics on instrument-creation errors, so a clean call
+	// against a real (no-op) MeterProvider is the test: it would panic on any
+	// malformed instrument description.
+	m := newClientMetrics(noop.NewMeterProvider())
+
+	ctx := context.Background()
+	m.recordWrite(ctx, "OK", 12.5)
+	m.recordDropped(ctx, dropReasonInvalidArgument, 3)
+	m.recordDescriptorCreated(ctx)
+	m.recordDescriptorCacheHit(ctx)
+}
+
+func TestClientMetricsNilSafe(t *testing.T) {
+	var m *ClientMetrics
+	ctx := context.Background()
+
+	// None of these should panic on a nil *ClientMetrics, since Exporter and
+	// DescriptorRegistry call them unconditionally whether or not a caller
+	// opted into metrics via WithClientMetrics.
+	m.recordWrite(ctx, "OK", 1)
+	m.recordDropped(ctx, dropReasonDeadline, 1)
+	m.recordDescriptorCreated(ctx)
+	m.recordDescriptorCacheHit(ctx)
+}
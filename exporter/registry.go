@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DescriptorRegistry memoizes CreateMetricDescriptor calls by metric type so
+// that repeated in-process publishes of the same metric don't generate
+// audit-log noise. It also remembers permanent failures, keyed by the
+// descriptor's content hash, so a permanently broken descriptor doesn't
+// trigger a CreateMetricDescriptor call on every point published for it.
+// The cache is held in memory only: a new process starts with an empty
+// registry and calls CreateMetricDescriptor again the first time it sees a
+// metric type.
+type DescriptorRegistry struct {
+	// createDescriptor defaults to client.CreateMetricDescriptor; tests
+	// substitute a fake so the singleflight dedup logic can be exercised
+	// without a real MetricClient.
+	createDescriptor func(context.Context, *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error)
+
+	metrics *ClientMetrics
+
+	// inflight collapses concurrent Ensure calls for the same metric type into
+	// a single CreateMetricDescriptor call, keyed by desc.Type.
+	inflight singleflight.Group
+
+	mu      sync.Mutex
+	created map[string]*metricpb.MetricDescriptor // metricType -> descriptor
+	failed  map[string]string                     // metricType -> content hash that failed
+}
+
+// NewDescriptorRegistry creates a DescriptorRegistry that issues
+// CreateMetricDescriptor calls through client.
+func NewDescriptorRegistry(client *monitoring.MetricClient) *DescriptorRegistry {
+	return &DescriptorRegistry{
+		createDescriptor: func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error) {
+			return client.CreateMetricDescriptor(ctx, req)
+		},
+		created: make(map[string]*metricpb.MetricDescriptor),
+		failed:  make(map[string]string),
+	}
+}
+
+// WithClientMetrics attaches mp to the registry so that Ensure records
+// gcm.descriptors.created and gcm.descriptors.cache_hits. It returns r for
+// chaining.
+func (r *DescriptorRegistry) WithClientMetrics(mp metric.MeterProvider) *DescriptorRegistry {
+	r.metrics = newClientMetrics(mp)
+	return r
+}
+
+// Ensure creates desc under project if it hasn't already been created or
+// permanently rejected in this registry. On a cache hit (either a prior
+// success or a prior failure with an unchanged content hash) Ensure returns
+// immediately without calling GCM. Concurrent Ensure calls for the same
+// metric type that both miss the cache are collapsed into a single
+// CreateMetricDescriptor call via singleflight, rather than each issuing
+// their own — otherwise two in-process publishers racing to create the same
+// descriptor would double the exact audit-log noise this registry exists to
+// avoid.
+func (r *DescriptorRegistry) Ensure(ctx context.Context, project string, desc *metricpb.MetricDescriptor) (*metricpb.MetricDescriptor, error) {
+	hash := descriptorHash(desc)
+
+	if cached, err, hit := r.checkCache(ctx, desc.Type, hash); hit {
+		return cached, err
+	}
+
+	v, err, _ := r.inflight.Do(desc.Type, func() (any, error) {
+		// Re-check: a concurrent call may have already created (or
+		// permanently failed) this descriptor between our cache check above
+		// and joining the singleflight call.
+		if cached, err, hit := r.checkCache(ctx, desc.Type, hash); hit {
+			return cached, err
+		}
+
+		created, err := r.createDescriptor(ctx, &monitoringpb.CreateMetricDescriptorRequest{
+			Name:             "projects/" + project,
+			MetricDescriptor: desc,
+		})
+		if err != nil {
+			if isPermanentDescriptorError(err) {
+				r.mu.Lock()
+				r.failed[desc.Type] = hash
+				r.mu.Unlock()
+			}
+			return nil, fmt.Errorf("create metric descriptor %s: %w", desc.Type, err)
+		}
+
+		r.mu.Lock()
+		r.created[desc.Type] = created
+		delete(r.failed, desc.Type)
+		r.mu.Unlock()
+		r.metrics.recordDescriptorCreated(ctx)
+		return created, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*metricpb.MetricDescriptor), nil
+}
+
+// checkCache reports whether metricType has already been resolved: hit is
+// true if it was previously created (cached returned, err nil) or
+// permanently failed with the same content hash (cached nil, err wrapping
+// errDescriptorPermanentlyFailed). hit is false on a cache miss, meaning the
+// caller still needs to call CreateMetricDescriptor.
+func (r *DescriptorRegistry) checkCache(ctx context.Context, metricType, hash string) (cached *metricpb.MetricDescriptor, err error, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cached, ok := r.created[metricType]; ok {
+		r.metrics.recordDescriptorCacheHit(ctx)
+		return cached, nil, true
+	}
+	if failedHash, ok := r.failed[metricType]; ok && failedHash == hash {
+		r.metrics.recordDescriptorCacheHit(ctx)
+		return nil, fmt.Errorf("descriptor %s previously failed permanently with this content, skipping create: %w", metricType, errDescriptorPermanentlyFailed), true
+	}
+	return nil, nil, false
+}
+
+// errDescriptorPermanentlyFailed is wrapped by Ensure when it short-circuits
+// a descriptor that previously failed with unchanged content.
+var errDescriptorPermanentlyFailed = fmt.Errorf("descriptor permanently failed")
+
+// isPermanentDescriptorError reports whether err from CreateMetricDescriptor
+// indicates the descriptor itself is invalid and retrying with the same
+// content would fail again.
+func isPermanentDescriptorError(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch st.Code() {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.PermissionDenied, codes.AlreadyExists:
+		return true
+	default:
+		return false
+	}
+}
+
+// descriptorHash hashes the structural fields of desc that determine
+// whether GCM will accept it: labels, kind, value type, and unit. Two
+// descriptors with the same type but different content hash to different
+// values, so a fixed descriptor is retried instead of permanently skipped.
+func descriptorHash(desc *metricpb.MetricDescriptor) string {
+	labels := make([]string, 0, len(desc.GetLabels()))
+	for _, l := range desc.GetLabels() {
+		labels = append(labels, fmt.Sprintf("%s:%s", l.GetKey(), l.GetValueType()))
+	}
+	sort.Strings(labels)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%v", desc.GetType(), desc.GetMetricKind(), desc.GetValueType(), desc.GetUnit(), labels)
+	return hex.EncodeToString(h.Sum(nil))
+}
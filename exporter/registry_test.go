@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestDescriptorRegistryEnsureCollapsesConcurrentMisses verifies that
+// concurrent Ensure calls for the same, not-yet-cached metric type issue a
+// single CreateMetricDescriptor call rather than one per caller.
+func TestDescriptorRegistryEnsureCollapsesConcurrentMisses(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	r := &DescriptorRegistry{
+		createDescriptor: func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return req.GetMetricDescriptor(), nil
+		},
+		created: make(map[string]*metricpb.MetricDescriptor),
+		failed:  make(map[string]string),
+	}
+
+	desc := &metricpb.MetricDescriptor{Type: "custom.googleapis.com/test"}
+
+	const n = 10
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := r.Ensure(context.Background(), "proj", desc); err != nil {
+				t.Errorf("Ensure: %v", err)
+			}
+		}()
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("CreateMetricDescriptor called %d times, want 1", got)
+	}
+}
+
+// TestDescriptorRegistryEnsureCachesPermanentFailure verifies that a
+// permanent failure is cached so a later Ensure call with the same content
+// doesn't re-issue CreateMetricDescriptor.
+func TestDescriptorRegistryEnsureCachesPermanentFailure(t *testing.T) {
+	var calls int32
+	r := &DescriptorRegistry{
+		createDescriptor: func(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, status.Error(codes.InvalidArgument, "bad descriptor")
+		},
+		created: make(map[string]*metricpb.MetricDescriptor),
+		failed:  make(map[string]string),
+	}
+
+	desc := &metricpb.MetricDescriptor{Type: "custom.googleapis.com/test"}
+
+	if _, err := r.Ensure(context.Background(), "proj", desc); err == nil {
+		t.Fatal("Ensure: want error on first call")
+	}
+	if _, err := r.Ensure(context.Background(), "proj", desc); err == nil {
+		t.Fatal("Ensure: want error on second call")
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("CreateMetricDescriptor called %d times, want 1", got)
+	}
+}
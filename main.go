@@ -5,7 +5,6 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"google.golang.org/genproto/googleapis/api/distribution"
 	"google.golang.org/genproto/googleapis/api/label"
 	metricpb "google.golang.org/genproto/googleapis/api/metric"
 	"google.golang.org/genproto/googleapis/api/monitoredres"
@@ -18,11 +17,15 @@ import (
 	"os/exec"
 	"os/signal"
 	"time"
+
+	"github.com/jschaf/gcp-monitoring-resource-weirdness/exporter"
+	"github.com/jschaf/gcp-monitoring-resource-weirdness/resource"
+	"github.com/jschaf/gcp-monitoring-resource-weirdness/verify"
 )
 
 var (
-	projectID         = flag.String("project-id", "", "GCP project ID")
-	monitoredResource = flag.String("monitored-resource", "generic_task", "one of generic_task; none; k8s_container")
+	projectID   = flag.String("project-id", "", "GCP project ID")
+	verifyWrite = flag.Bool("verify", false, "read back the written time series and diff it against what was submitted")
 )
 
 const (
@@ -70,14 +73,30 @@ func runMain() error {
 		return fmt.Errorf("create gcp monitoring client: %w", err)
 	}
 
-	metricDesc, err := createHistogramDescriptor(ctx, metricClient)
+	registry := exporter.NewDescriptorRegistry(metricClient)
+	metricDesc, err := ensureHistogramDescriptor(ctx, registry)
 	if err != nil {
-		return fmt.Errorf("create histogram descriptor: %w", err)
+		return fmt.Errorf("ensure histogram descriptor: %w", err)
+	}
+
+	detector := newResourceDetector(*projectID)
+	res, ok, err := detector.Detect(ctx)
+	if err != nil {
+		return fmt.Errorf("detect monitored resource: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("no monitored resource detector matched")
 	}
 
-	_, err = createHistogramTimeSeries(ctx, metricClient)
+	series, err := publishHistogramTimeSeries(ctx, metricClient, res)
 	if err != nil {
-		return fmt.Errorf("create histogram time series: %w", err)
+		return fmt.Errorf("publish histogram time series: %w", err)
+	}
+
+	if *verifyWrite {
+		if err := verifyHistogramTimeSeries(ctx, metricClient, series); err != nil {
+			return fmt.Errorf("verify histogram time series: %w", err)
+		}
 	}
 
 	fmt.Printf("\n%s: showing CreateMetricDescriptor audit logs; sleeping\n", Blue.Add("[AUDIT LOGS]"))
@@ -101,34 +120,34 @@ func runMain() error {
 	return nil
 }
 
-func createHistogramDescriptor(ctx context.Context, client *monitoring.MetricClient) (*metricpb.MetricDescriptor, error) {
-	desc, err := client.CreateMetricDescriptor(ctx, &monitoringpb.CreateMetricDescriptorRequest{
-		Name: "projects/" + *projectID,
-		MetricDescriptor: &metricpb.MetricDescriptor{
-			Name: fmt.Sprintf("projects/%s/metricDescriptors/%s", *projectID, metricType),
-			Type: metricType,
-			Labels: []*label.LabelDescriptor{
-				{Key: "key_a", ValueType: label.LabelDescriptor_STRING, Description: "some key a"},
-			},
-			MetricKind:  metricpb.MetricDescriptor_GAUGE,
-			ValueType:   metricpb.MetricDescriptor_DISTRIBUTION,
-			Unit:        "ms",
-			Description: "test histogram",
-			DisplayName: "Test Histogram Display name",
-			MonitoredResourceTypes: []string{
-				"generic_task",
-				"k8s_container",
-			},
-			Metadata: nil, // not needed
-			//LaunchStage: api.LaunchStage_GA, // optional, not needed
+// ensureHistogramDescriptor creates the test histogram's MetricDescriptor
+// through registry, instead of calling CreateMetricDescriptor directly, so
+// repeated Ensure calls within this process don't re-issue the same create
+// call and generate audit-log noise. The registry is new on every run, so
+// each run still issues one CreateMetricDescriptor call.
+func ensureHistogramDescriptor(ctx context.Context, registry *exporter.DescriptorRegistry) (*metricpb.MetricDescriptor, error) {
+	desc, err := registry.Ensure(ctx, *projectID, &metricpb.MetricDescriptor{
+		Name: fmt.Sprintf("projects/%s/metricDescriptors/%s", *projectID, metricType),
+		Type: metricType,
+		Labels: []*label.LabelDescriptor{
+			{Key: "key_a", ValueType: label.LabelDescriptor_STRING, Description: "some key a"},
+		},
+		MetricKind:  metricpb.MetricDescriptor_GAUGE,
+		ValueType:   metricpb.MetricDescriptor_DISTRIBUTION,
+		Unit:        "ms",
+		Description: "test histogram",
+		DisplayName: "Test Histogram Display name",
+		MonitoredResourceTypes: []string{
+			"generic_task",
+			"k8s_container",
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("create metric descriptor: %w", err)
+		return nil, fmt.Errorf("ensure metric descriptor: %w", err)
 	}
 
 	fmt.Printf("\n%s\n%s\n", Blue.Add("[CREATED METRIC DESCRIPTOR]"), mustMarshalProtoText(desc))
-	return desc, err
+	return desc, nil
 }
 
 func mustMarshalProtoText(desc proto.Message) string {
@@ -139,6 +158,37 @@ func mustMarshalProtoText(desc proto.Message) string {
 	return string(descTxt)
 }
 
+// verifyHistogramTimeSeries reads series back from GCM and prints any
+// differences from what was submitted, surfacing the kind of silent label
+// drops and unit/bucket coercion this repo is exploring.
+func verifyHistogramTimeSeries(ctx context.Context, client *monitoring.MetricClient, series *monitoringpb.TimeSeries) error {
+	fmt.Printf("\n%s: polling for the written point (GCM ingestion lag can be a couple minutes)\n", Blue.Add("[VERIFY]"))
+
+	d, err := verify.New(client).Verify(ctx, *projectID, series)
+	if err != nil {
+		return err
+	}
+	if d.Empty() {
+		fmt.Printf("\n%s\n", Green.Add("[VERIFY] no differences between submitted and observed time series"))
+		return nil
+	}
+
+	fmt.Printf("\n%s\n", Yellow.Add("[VERIFY] submitted and observed time series differ:"))
+	if len(d.DroppedLabels) > 0 {
+		fmt.Printf("  dropped metric labels: %v\n", d.DroppedLabels)
+	}
+	for key, change := range d.ResourceLabelChanges {
+		fmt.Printf("  resource label %q rewritten: %s\n", key, change)
+	}
+	if d.UnitChanged {
+		fmt.Printf("  unit coerced: %q -> %q\n", d.SubmittedUnit, d.ObservedUnit)
+	}
+	if d.BucketBoundsChanged {
+		fmt.Printf("  bucket bounds rounded: %v -> %v\n", d.SubmittedBounds, d.ObservedBounds)
+	}
+	return nil
+}
+
 func getMetricDescriptor(ctx context.Context, client *monitoring.MetricClient, desc *metricpb.MetricDescriptor) (*metricpb.MetricDescriptor, error) {
 	desc, err := client.GetMetricDescriptor(ctx, &monitoringpb.GetMetricDescriptorRequest{
 		Name: desc.Name,
@@ -147,77 +197,49 @@ func getMetricDescriptor(ctx context.Context, client *monitoring.MetricClient, d
 	return desc, err
 }
 
-func createHistogramTimeSeries(ctx context.Context, metricClient *monitoring.MetricClient) (*monitoringpb.TimeSeries, error) {
-	series := &monitoringpb.TimeSeries{
-		Metric:     &metricpb.Metric{Type: metricType, Labels: map[string]string{"key_a": "value-a"}},
-		MetricKind: metricpb.MetricDescriptor_GAUGE,
-		ValueType:  metricpb.MetricDescriptor_DISTRIBUTION,
-		Points:     []*monitoringpb.Point{newHistogramPoint()},
-		Unit:       "ms",
-	}
-	switch *monitoredResource {
-	case "generic_task":
-		series.Resource = &monitoredres.MonitoredResource{
-			Type: "generic_task",
-			Labels: map[string]string{
-				"project_id": *projectID,
-				"location":   "us-central1", // must be a GCP region or zone
-				"namespace":  "test",
-				"job":        "test-job",
-				"task_id":    "test-task",
-			},
-		}
-	case "k8s_container":
-		series.Resource = &monitoredres.MonitoredResource{
-			Type: "k8s_container",
-			Labels: map[string]string{
-				"project_id":     *projectID,
-				"location":       "us-central1", // must be a GCP region or zone
-				"cluster_name":   "test-cluster",
-				"namespace_name": "test-namespace",
-				"pod_name":       "test-pod",
-				"container_name": "test-container",
-			},
-		}
-	case "none":
-		series.Resource = nil
-	default:
-		return nil, fmt.Errorf("unknown monitored resource: %s", *monitoredResource)
-	}
-	fmt.Printf("\n%s\n%s\n", Blue.Add("[CREATED TIME SERIES]"), mustMarshalProtoText(series))
-
-	err := metricClient.CreateTimeSeries(ctx, &monitoringpb.CreateTimeSeriesRequest{
-		Name:       "projects/" + *projectID,
-		TimeSeries: []*monitoringpb.TimeSeries{series},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("create time series: %w", err)
-	}
-	return series, nil
+// newResourceDetector builds the chain of MonitoredResource detectors tried
+// at startup, in order from most to least specific, falling back to
+// generic_task if nothing more specific matches. The result of the first
+// Detect is cached, whether it matched, missed, or returned an error.
+func newResourceDetector(projectID string) resource.Detector {
+	return resource.Cached(resource.Chain(
+		resource.GKEContainer(),
+		resource.GCEInstance(),
+		resource.CloudRunRevision(),
+		resource.CloudFunction(),
+		resource.AWSEC2Instance(),
+		resource.GenericTask(projectID, "us-central1", "test", "test-job", "test-task"),
+	))
 }
 
-func newHistogramPoint() *monitoringpb.Point {
+// publishHistogramTimeSeries records a couple of sample observations into a
+// SeriesGrouper, which coalesces them into a single aggregated Distribution
+// point, then hands that point to an Exporter instead of calling
+// CreateTimeSeries directly. Shutdown is called immediately after Add so this
+// one-shot demo still observes the write before returning; a long-running
+// caller would instead leave the Exporter's background flush loop running and
+// keep calling Add as observations come in.
+func publishHistogramTimeSeries(ctx context.Context, metricClient *monitoring.MetricClient, res *monitoredres.MonitoredResource) (*monitoringpb.TimeSeries, error) {
+	grouper := exporter.NewSeriesGrouper(exporter.ExplicitBuckets([]float64{10, 50, 70}), "ms")
+	labels := map[string]string{"key_a": "value-a"}
 	now := timestamppb.Now()
-	return &monitoringpb.Point{
-		Interval: &monitoringpb.TimeInterval{
-			EndTime:   now, // for gauge metrics, start must equal end
-			StartTime: now,
-		},
-		Value: &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DistributionValue{
-			DistributionValue: &distribution.Distribution{
-				Count:                 2,
-				Mean:                  30,
-				SumOfSquaredDeviation: 15,
-				Range:                 nil, // GCP errors if set: "Distribution range is not supported"
-				BucketOptions: &distribution.Distribution_BucketOptions{
-					Options: &distribution.Distribution_BucketOptions_ExplicitBuckets{
-						ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{
-							Bounds: []float64{10, 50, 70},
-						},
-					},
-				},
-				BucketCounts: []int64{0, 1, 1, 0}, // len(Bounds) + buckets for explicit buckets
-			},
-		}},
+	grouper.Add(metricType, labels, res, now, 20)
+	grouper.Add(metricType, labels, res, now, 60)
+
+	series := grouper.Flush()
+	if len(series) != 1 {
+		return nil, fmt.Errorf("want 1 grouped time series, got %d", len(series))
 	}
+	fmt.Printf("\n%s\n%s\n", Blue.Add("[CREATED TIME SERIES]"), mustMarshalProtoText(series[0]))
+
+	exp := exporter.New(metricClient)
+	exp.Start()
+	if err := exp.Add(ctx, "projects/"+*projectID, series...); err != nil {
+		return nil, fmt.Errorf("buffer time series: %w", err)
+	}
+	if err := exp.Shutdown(ctx); err != nil {
+		return nil, fmt.Errorf("flush time series: %w", err)
+	}
+
+	return series[0], nil
 }
@@ -0,0 +1,106 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// awsIMDSTokenURL and awsIMDSDocURL are the IMDSv2 endpoints used to detect
+// and describe an AWS EC2 instance.
+const (
+	awsIMDSTokenURL = "http://169.254.169.254/latest/api/token"
+	awsIMDSDocURL   = "http://169.254.169.254/latest/dynamic/instance-identity/document"
+	awsIMDSTimeout  = 2 * time.Second
+)
+
+// awsIdentityDocument is the subset of the IMDS instance-identity document
+// needed to populate the aws_ec2_instance MonitoredResource.
+type awsIdentityDocument struct {
+	InstanceID string `json:"instanceId"`
+	Region     string `json:"region"`
+	AccountID  string `json:"accountId"`
+}
+
+// AWSEC2Instance detects the aws_ec2_instance MonitoredResource by querying
+// the IMDSv2 instance metadata service. It returns ok=false (rather than an
+// error) when IMDS isn't reachable, since that's the expected signal for
+// "not running on an EC2 instance" rather than a hard failure.
+func AWSEC2Instance() Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		ctx, cancel := context.WithTimeout(ctx, awsIMDSTimeout)
+		defer cancel()
+
+		client := &http.Client{}
+
+		token, err := awsIMDSToken(ctx, client)
+		if err != nil {
+			return nil, false, nil
+		}
+
+		doc, err := awsIMDSIdentityDocument(ctx, client, token)
+		if err != nil {
+			return nil, false, nil
+		}
+
+		return &monitoredres.MonitoredResource{
+			Type: "aws_ec2_instance",
+			Labels: map[string]string{
+				"project_id":  doc.AccountID,
+				"instance_id": doc.InstanceID,
+				"region":      "aws:" + doc.Region,
+				"aws_account": doc.AccountID,
+			},
+		}, true, nil
+	})
+}
+
+func awsIMDSToken(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsIMDSTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("imds token request: unexpected status %d", resp.StatusCode)
+	}
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+func awsIMDSIdentityDocument(ctx context.Context, client *http.Client, token string) (*awsIdentityDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, awsIMDSDocURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("imds identity document request: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc awsIdentityDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode imds identity document: %w", err)
+	}
+	return &doc, nil
+}
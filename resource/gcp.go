@@ -0,0 +1,237 @@
+package resource
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// GCEInstance detects the gce_instance MonitoredResource by querying the GCE
+// metadata server. It returns ok=false, with no error, both when not running
+// on GCE (or inside a GKE pod, which GKEContainer should detect first) and
+// when OnGCE is confirmed but a later metadata lookup fails — a transient
+// metadata-server hiccup shouldn't kill the rest of the detector Chain.
+func GCEInstance() Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		c := metadata.NewClient(nil)
+		if !c.OnGCEWithContext(ctx) {
+			return nil, false, nil
+		}
+		// A GKE pod also reports OnGCE=true, so defer to GKEContainer for that case.
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			return nil, false, nil
+		}
+
+		projectID, err := c.ProjectIDWithContext(ctx)
+		if err != nil {
+			slog.Warn("gce instance detector: get project id", slog.Any("err", err))
+			return nil, false, nil
+		}
+		zone, err := c.ZoneWithContext(ctx)
+		if err != nil {
+			slog.Warn("gce instance detector: get zone", slog.Any("err", err))
+			return nil, false, nil
+		}
+		instanceID, err := c.InstanceIDWithContext(ctx)
+		if err != nil {
+			slog.Warn("gce instance detector: get instance id", slog.Any("err", err))
+			return nil, false, nil
+		}
+
+		return &monitoredres.MonitoredResource{
+			Type: "gce_instance",
+			Labels: map[string]string{
+				"project_id":  projectID,
+				"instance_id": instanceID,
+				"zone":        zone,
+			},
+		}, true, nil
+	})
+}
+
+// GKEContainer detects the k8s_container MonitoredResource for a pod running
+// in GKE. It relies on KUBERNETES_SERVICE_HOST, which kubelet sets in every
+// pod, plus the downward-API env vars (NAMESPACE, POD_NAME, CONTAINER_NAME)
+// that callers are expected to set via the pod spec's `env.valueFrom`.
+// Cluster name and location come from the GCE metadata server. As with
+// GCEInstance, a metadata lookup failure after the platform is confirmed
+// yields ok=false rather than an error, so a transient hiccup doesn't kill
+// the rest of the detector Chain.
+func GKEContainer() Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+			return nil, false, nil
+		}
+
+		c := metadata.NewClient(nil)
+		if !c.OnGCEWithContext(ctx) {
+			return nil, false, nil
+		}
+
+		projectID, err := c.ProjectIDWithContext(ctx)
+		if err != nil {
+			slog.Warn("gke container detector: get project id", slog.Any("err", err))
+			return nil, false, nil
+		}
+		zone, err := c.ZoneWithContext(ctx)
+		if err != nil {
+			slog.Warn("gke container detector: get zone", slog.Any("err", err))
+			return nil, false, nil
+		}
+		clusterName, err := c.InstanceAttributeValueWithContext(ctx, "cluster-name")
+		if err != nil {
+			slog.Warn("gke container detector: get cluster name", slog.Any("err", err))
+			return nil, false, nil
+		}
+
+		return &monitoredres.MonitoredResource{
+			Type: "k8s_container",
+			Labels: map[string]string{
+				"project_id":     projectID,
+				"location":       zone,
+				"cluster_name":   strings.TrimSpace(clusterName),
+				"namespace_name": os.Getenv("NAMESPACE"),
+				"pod_name":       os.Getenv("POD_NAME"),
+				"container_name": os.Getenv("CONTAINER_NAME"),
+			},
+		}, true, nil
+	})
+}
+
+// CloudRunRevision detects the cloud_run_revision MonitoredResource using
+// the K_SERVICE/K_REVISION/K_CONFIGURATION env vars the Cloud Run runtime
+// always sets. A metadata lookup failure after K_SERVICE confirms the
+// platform yields ok=false rather than an error, so a transient hiccup
+// doesn't kill the rest of the detector Chain.
+//
+// 2nd-gen Cloud Functions also run on Cloud Run infrastructure and set the
+// same K_SERVICE/K_REVISION/K_CONFIGURATION env vars, so this detector
+// defers to CloudFunction by bailing out when FUNCTION_TARGET or
+// FUNCTION_SIGNATURE_TYPE is set, regardless of chain ordering.
+func CloudRunRevision() Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		service := os.Getenv("K_SERVICE")
+		if service == "" {
+			return nil, false, nil
+		}
+		if os.Getenv("FUNCTION_TARGET") != "" || os.Getenv("FUNCTION_SIGNATURE_TYPE") != "" {
+			return nil, false, nil
+		}
+
+		c := metadata.NewClient(nil)
+		projectID, err := c.ProjectIDWithContext(ctx)
+		if err != nil {
+			slog.Warn("cloud run detector: get project id", slog.Any("err", err))
+			return nil, false, nil
+		}
+		region, err := cloudRunRegion(ctx, c)
+		if err != nil {
+			slog.Warn("cloud run detector: get region", slog.Any("err", err))
+			return nil, false, nil
+		}
+
+		return &monitoredres.MonitoredResource{
+			Type: "cloud_run_revision",
+			Labels: map[string]string{
+				"project_id":         projectID,
+				"location":           region,
+				"service_name":       service,
+				"revision_name":      os.Getenv("K_REVISION"),
+				"configuration_name": os.Getenv("K_CONFIGURATION"),
+			},
+		}, true, nil
+	})
+}
+
+// CloudFunction detects the cloud_function MonitoredResource. It supports
+// both the 2nd-gen runtime (K_SERVICE plus FUNCTION_TARGET or
+// FUNCTION_SIGNATURE_TYPE) and the legacy 1st gen runtime (FUNCTION_NAME,
+// FUNCTION_REGION). A metadata lookup failure
+// after the platform is confirmed yields ok=false rather than an error, so a
+// transient hiccup doesn't kill the rest of the detector Chain.
+func CloudFunction() Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		name := os.Getenv("FUNCTION_NAME")
+		if name == "" && (os.Getenv("FUNCTION_TARGET") != "" || os.Getenv("FUNCTION_SIGNATURE_TYPE") != "") {
+			name = os.Getenv("K_SERVICE")
+		}
+		if name == "" {
+			return nil, false, nil
+		}
+
+		c := metadata.NewClient(nil)
+		projectID, err := c.ProjectIDWithContext(ctx)
+		if err != nil {
+			slog.Warn("cloud function detector: get project id", slog.Any("err", err))
+			return nil, false, nil
+		}
+		region := os.Getenv("FUNCTION_REGION")
+		if region == "" {
+			region, err = cloudRunRegion(ctx, c)
+			if err != nil {
+				slog.Warn("cloud function detector: get region", slog.Any("err", err))
+				return nil, false, nil
+			}
+		}
+
+		return &monitoredres.MonitoredResource{
+			Type: "cloud_function",
+			Labels: map[string]string{
+				"project_id":    projectID,
+				"region":        region,
+				"function_name": name,
+			},
+		}, true, nil
+	})
+}
+
+// cloudRunRegion extracts the region from the numeric-project-id form of the
+// GCE metadata region path, e.g. "projects/123456789/regions/us-central1".
+func cloudRunRegion(ctx context.Context, c *metadata.Client) (string, error) {
+	region, err := c.GetWithContext(ctx, "instance/region")
+	if err != nil {
+		return "", err
+	}
+	return path.Base(region), nil
+}
+
+// GenericTask returns a Detector that always matches, falling back to the
+// generic_task MonitoredResource. It's meant to be the last entry in a
+// Chain. namespace and job identify the publishing application; taskID
+// distinguishes replicas (e.g. a hostname or pod name).
+func GenericTask(projectID, location, namespace, job, taskID string) Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		return &monitoredres.MonitoredResource{
+			Type: "generic_task",
+			Labels: map[string]string{
+				"project_id": projectID,
+				"location":   location,
+				"namespace":  namespace,
+				"job":        job,
+				"task_id":    taskID,
+			},
+		}, true, nil
+	})
+}
+
+// GenericNode returns a Detector that always matches, falling back to the
+// generic_node MonitoredResource, for publishers that represent a whole
+// host/node rather than a task replica.
+func GenericNode(projectID, location, namespace, nodeID string) Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		return &monitoredres.MonitoredResource{
+			Type: "generic_node",
+			Labels: map[string]string{
+				"project_id": projectID,
+				"location":   location,
+				"namespace":  namespace,
+				"node_id":    nodeID,
+			},
+		}, true, nil
+	})
+}
@@ -0,0 +1,57 @@
+package resource
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestCloudRunRevisionDefersTo2ndGenCloudFunction verifies that
+// CloudRunRevision bails out (ok=false) rather than misreporting a 2nd-gen
+// Cloud Function, which also sets K_SERVICE/K_REVISION/K_CONFIGURATION,
+// as a cloud_run_revision. Both env var markers documented for 2nd-gen
+// functions are covered since either can be set depending on the trigger
+// type.
+func TestCloudRunRevisionDefersTo2ndGenCloudFunction(t *testing.T) {
+	tests := []struct {
+		name   string
+		envVar string
+	}{
+		{"FUNCTION_TARGET set", "FUNCTION_TARGET"},
+		{"FUNCTION_SIGNATURE_TYPE set", "FUNCTION_SIGNATURE_TYPE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, kv := range [][2]string{
+				{"K_SERVICE", "my-function"},
+				{"K_REVISION", "my-function-00001-abc"},
+				{"K_CONFIGURATION", "my-function"},
+				{tt.envVar, "helloWorld"},
+			} {
+				t.Setenv(kv[0], kv[1])
+			}
+
+			_, ok, err := CloudRunRevision().Detect(context.Background())
+			if err != nil {
+				t.Fatalf("Detect: %v", err)
+			}
+			if ok {
+				t.Error("CloudRunRevision matched a 2nd-gen Cloud Function environment, want ok=false")
+			}
+		})
+	}
+}
+
+func TestCloudRunRevisionNoMatchWithoutKService(t *testing.T) {
+	if os.Getenv("K_SERVICE") != "" {
+		t.Skip("K_SERVICE already set in the ambient environment")
+	}
+	_, ok, err := CloudRunRevision().Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if ok {
+		t.Error("CloudRunRevision matched with no K_SERVICE set, want ok=false")
+	}
+}
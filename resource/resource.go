@@ -0,0 +1,76 @@
+// Package resource detects which GCP (or AWS) MonitoredResource a process
+// is running as, so callers don't have to hardcode a MonitoredResource
+// type and labels.
+package resource
+
+import (
+	"context"
+	"sync"
+
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// Detector detects a MonitoredResource describing the environment the
+// process is running in. Detect returns ok=false, with no error, when the
+// environment doesn't match this detector (e.g. the GCE detector running
+// outside GCE).
+type Detector interface {
+	Detect(ctx context.Context) (res *monitoredres.MonitoredResource, ok bool, err error)
+}
+
+// DetectorFunc adapts a function to a Detector.
+type DetectorFunc func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error)
+
+// Detect calls f.
+func (f DetectorFunc) Detect(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+	return f(ctx)
+}
+
+// Chain tries each detector in order and returns the first that matches.
+// If none match, Chain returns ok=false.
+func Chain(detectors ...Detector) Detector {
+	return DetectorFunc(func(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+		for _, d := range detectors {
+			res, ok, err := d.Detect(ctx)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				return res, true, nil
+			}
+		}
+		return nil, false, nil
+	})
+}
+
+// Cached wraps d so that Detect only runs once; subsequent calls return the
+// cached result. This is the expected usage for resource detection, since a
+// process's environment doesn't change at runtime.
+func Cached(d Detector) Detector {
+	c := &cachedDetector{inner: d}
+	return c
+}
+
+type cachedDetector struct {
+	inner Detector
+
+	once sync.Once
+	res  *monitoredres.MonitoredResource
+	ok   bool
+	err  error
+}
+
+func (c *cachedDetector) Detect(ctx context.Context) (*monitoredres.MonitoredResource, bool, error) {
+	c.once.Do(func() {
+		c.res, c.ok, c.err = c.inner.Detect(ctx)
+	})
+	return c.res, c.ok, c.err
+}
+
+// ByDescriptorFunc lets a caller strip labels from a Metric and promote them
+// onto the MonitoredResource on a per-descriptor basis — e.g. moving
+// cluster_name from metric labels onto a k8s_container resource's labels.
+// It returns the resource to use (nil to keep the detected default) and the
+// remaining metric labels after any promoted ones are removed.
+type ByDescriptorFunc func(desc *metricpb.MetricDescriptor, metricLabels map[string]string) (*monitoredres.MonitoredResource, map[string]string)
@@ -0,0 +1,177 @@
+// Package verify turns a CreateTimeSeries call into a conformance check by
+// reading the point back from Google Cloud Monitoring and diffing it
+// against what was submitted. GCM silently drops unrecognized labels,
+// coerces units, and rounds bucket boundaries, so a successful write
+// doesn't guarantee the point was stored as sent; this package surfaces
+// that "weirdness" instead of assuming the write was stored as sent.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"google.golang.org/api/iterator"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// pollInterval and pollTimeout bound how long Verify waits for a
+// just-written point to show up in ListTimeSeries. GCM's own docs describe
+// ingestion lag of up to ~2 minutes for custom metrics.
+const (
+	pollInterval = 5 * time.Second
+	pollTimeout  = 2 * time.Minute
+)
+
+// Diff describes how a TimeSeries read back from GCM differs from the one
+// that was submitted.
+type Diff struct {
+	// DroppedLabels are metric label keys present in Submitted but absent
+	// from Observed.
+	DroppedLabels []string
+	// ResourceLabelChanges maps a MonitoredResource label key to the
+	// "submitted -> observed" values, for keys GCM rewrote.
+	ResourceLabelChanges map[string]string
+	// UnitChanged is set if GCM stored a different Unit than was submitted.
+	UnitChanged                 bool
+	SubmittedUnit, ObservedUnit string
+	// BucketBoundsChanged is set if GCM rounded or altered explicit bucket
+	// boundaries.
+	BucketBoundsChanged             bool
+	SubmittedBounds, ObservedBounds []float64
+}
+
+// Empty reports whether no differences were found.
+func (d *Diff) Empty() bool {
+	return d == nil ||
+		(len(d.DroppedLabels) == 0 &&
+			len(d.ResourceLabelChanges) == 0 &&
+			!d.UnitChanged &&
+			!d.BucketBoundsChanged)
+}
+
+// Verifier reads back a just-written TimeSeries and diffs it against what
+// was submitted.
+type Verifier struct {
+	client *monitoring.MetricClient
+}
+
+// New creates a Verifier that reads time series back through client.
+func New(client *monitoring.MetricClient) *Verifier {
+	return &Verifier{client: client}
+}
+
+// Verify polls ListTimeSeries, under project, for the metric type and
+// labels in submitted until the point appears (or pollTimeout elapses), then
+// diffs the observed point against submitted.
+func (v *Verifier) Verify(ctx context.Context, project string, submitted *monitoringpb.TimeSeries) (*Diff, error) {
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+
+	observed, err := v.pollForSeries(ctx, project, submitted)
+	if err != nil {
+		return nil, fmt.Errorf("poll for written time series: %w", err)
+	}
+
+	return diff(submitted, observed), nil
+}
+
+func (v *Verifier) pollForSeries(ctx context.Context, project string, submitted *monitoringpb.TimeSeries) (*monitoringpb.TimeSeries, error) {
+	filter := fmt.Sprintf(`metric.type="%s"`, submitted.GetMetric().GetType())
+	for label, value := range submitted.GetMetric().GetLabels() {
+		filter += fmt.Sprintf(` AND metric.labels.%s="%s"`, label, value)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		it := v.client.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+			Name:   "projects/" + project,
+			Filter: filter,
+			Interval: &monitoringpb.TimeInterval{
+				StartTime: submitted.GetPoints()[0].GetInterval().GetStartTime(),
+				EndTime:   submitted.GetPoints()[0].GetInterval().GetEndTime(),
+			},
+			View: monitoringpb.ListTimeSeriesRequest_FULL,
+		})
+		series, err := it.Next()
+		if err == nil {
+			return series, nil
+		}
+		if err != iterator.Done {
+			return nil, fmt.Errorf("list time series: %w", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for time series to appear: %w", ctx.Err())
+		}
+	}
+}
+
+// diff compares submitted against observed, the TimeSeries GCM actually
+// stored.
+func diff(submitted, observed *monitoringpb.TimeSeries) *Diff {
+	d := &Diff{ResourceLabelChanges: make(map[string]string)}
+
+	for key := range submitted.GetMetric().GetLabels() {
+		if _, ok := observed.GetMetric().GetLabels()[key]; !ok {
+			d.DroppedLabels = append(d.DroppedLabels, key)
+		}
+	}
+
+	subResource := submitted.GetResource().GetLabels()
+	obsResource := observed.GetResource().GetLabels()
+	for key, want := range subResource {
+		if got, ok := obsResource[key]; !ok || got != want {
+			d.ResourceLabelChanges[key] = fmt.Sprintf("%s -> %s", want, got)
+		}
+	}
+
+	if submitted.GetUnit() != observed.GetUnit() {
+		d.UnitChanged = true
+		d.SubmittedUnit = submitted.GetUnit()
+		d.ObservedUnit = observed.GetUnit()
+	}
+
+	subBounds := explicitBounds(submitted)
+	obsBounds := explicitBounds(observed)
+	if !boundsEqual(subBounds, obsBounds) {
+		d.BucketBoundsChanged = true
+		d.SubmittedBounds = subBounds
+		d.ObservedBounds = obsBounds
+	}
+
+	return d
+}
+
+// explicitBounds extracts the explicit bucket bounds from the first point
+// of series, if it carries a distribution value with explicit buckets.
+func explicitBounds(series *monitoringpb.TimeSeries) []float64 {
+	points := series.GetPoints()
+	if len(points) == 0 {
+		return nil
+	}
+	dist := points[0].GetValue().GetDistributionValue()
+	explicit := dist.GetBucketOptions().GetExplicitBuckets()
+	if explicit == nil {
+		return nil
+	}
+	return explicit.GetBounds()
+}
+
+func boundsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}